@@ -0,0 +1,45 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLockNotFound is returned by Backend.Get when no document exists for a
+// given lock ID.
+var ErrLockNotFound = errors.New("lock not found")
+
+// LockDoc is the storage-agnostic representation of a lock document, as
+// returned by a Backend.
+type LockDoc struct {
+	Owner    string
+	Acquired time.Time
+	Expires  time.Time
+}
+
+// AcquireResult describes the outcome of a Backend.AcquireDoc call.
+type AcquireResult struct {
+	// Acquired is true if the lock was newly created or taken over because
+	// it had expired, and false if a valid lock already existed.
+	Acquired bool
+}
+
+// Backend abstracts the storage engine a Lock is built on top of, so the
+// public Lock API doesn't have to be tied to a specific Elasticsearch client
+// or version. The Elasticsearch 6.x and 7.x implementations live in the
+// elasticv6 and elasticv7 subpackages; memlock provides an in-memory
+// implementation for use in tests that don't need a live cluster.
+type Backend interface {
+	// AcquireDoc creates the lock document if none exists, or takes it over
+	// if the existing one has expired, regardless of who owned it.
+	AcquireDoc(ctx context.Context, id, owner string, expires time.Time) (AcquireResult, error)
+	// ExtendDoc updates expires on the document, but only if it's still
+	// owned by owner. It returns ErrLockNotHeld otherwise.
+	ExtendDoc(ctx context.Context, id, owner string, expires time.Time) error
+	// DeleteIfOwner deletes the document if it's owned by owner, and
+	// reports how many documents were deleted (0 or 1).
+	DeleteIfOwner(ctx context.Context, id, owner string) (int, error)
+	// Get fetches the current lock document, or ErrLockNotFound if none exists.
+	Get(ctx context.Context, id string) (LockDoc, error)
+}
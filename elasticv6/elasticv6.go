@@ -0,0 +1,112 @@
+// Package elasticv6 implements the lock.Backend interface on top of
+// Elasticsearch 6.x via olivere/elastic.
+package elasticv6
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	lock "github.com/graup/es-distributed-lock"
+	"github.com/olivere/elastic"
+)
+
+// Backend stores lock documents in a single Elasticsearch 6.x index/type.
+type Backend struct {
+	client    *elastic.Client
+	indexName string
+	typeName  string
+}
+
+// New creates a Backend that stores lock documents in the given index/type.
+func New(client *elastic.Client, index, typ string) *Backend {
+	return &Backend{client: client, indexName: index, typeName: typ}
+}
+
+type lockSource struct {
+	Owner    string    `json:"owner"`
+	Acquired time.Time `json:"acquired"`
+	Expires  time.Time `json:"expires"`
+}
+
+// AcquireDoc implements lock.Backend.
+func (b *Backend) AcquireDoc(ctx context.Context, id, owner string, expires time.Time) (lock.AcquireResult, error) {
+	now := time.Now()
+	script := elastic.NewScript(`
+	if (ctx.op == "create") {
+		ctx._source.owner = params.owner;
+		ctx._source.acquired = params.acquired;
+		ctx._source.expires = params.expires;
+	} else if (ZonedDateTime.parse(ctx._source.expires).isAfter(ZonedDateTime.parse(params.now))) {
+		ctx.op = "none";
+	} else {
+		ctx._source.owner = params.owner;
+		ctx._source.acquired = params.acquired;
+		ctx._source.expires = params.expires;
+	}
+	`)
+	script.Params(map[string]interface{}{
+		"now":      now,
+		"owner":    owner,
+		"acquired": now,
+		"expires":  expires,
+	})
+	upsert := lockSource{Owner: owner, Acquired: now, Expires: expires}
+	resp, err := b.client.Update().Index(b.indexName).Type(b.typeName).Id(id).Script(script).Upsert(upsert).Refresh("true").ScriptedUpsert(true).Do(ctx)
+	if elastic.IsConflict(err) || err == nil && resp.Result == "noop" {
+		return lock.AcquireResult{Acquired: false}, nil
+	}
+	if err != nil {
+		return lock.AcquireResult{}, err
+	}
+	return lock.AcquireResult{Acquired: true}, nil
+}
+
+// ExtendDoc implements lock.Backend.
+func (b *Backend) ExtendDoc(ctx context.Context, id, owner string, expires time.Time) error {
+	script := elastic.NewScript(`
+	if (ctx._source.owner != params.owner) {
+		ctx.op = "none";
+	} else {
+		ctx._source.expires = params.expires;
+	}
+	`)
+	script.Params(map[string]interface{}{
+		"owner":   owner,
+		"expires": expires,
+	})
+	resp, err := b.client.Update().Index(b.indexName).Type(b.typeName).Id(id).Script(script).Refresh("true").Do(ctx)
+	if elastic.IsNotFound(err) || elastic.IsConflict(err) || err == nil && resp.Result == "noop" {
+		return lock.ErrLockNotHeld
+	}
+	return err
+}
+
+// DeleteIfOwner implements lock.Backend.
+func (b *Backend) DeleteIfOwner(ctx context.Context, id, owner string) (int, error) {
+	query := elastic.NewBoolQuery().Must(
+		elastic.NewTermQuery("_id", id),
+		elastic.NewTermQuery("owner.keyword", owner), // Without .keyword, this fails at matching analyzed strings (e.g. containing hyphens or spaces)
+	)
+	resp, err := b.client.DeleteByQuery().Index(b.indexName).Query(query).Refresh("true").Conflicts("proceed").Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.Deleted), nil
+}
+
+// Get implements lock.Backend.
+func (b *Backend) Get(ctx context.Context, id string) (lock.LockDoc, error) {
+	resp, err := b.client.Get().Index(b.indexName).Type(b.typeName).Id(id).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return lock.LockDoc{}, lock.ErrLockNotFound
+	}
+	if err != nil {
+		return lock.LockDoc{}, err
+	}
+	var src lockSource
+	if err := json.Unmarshal(*resp.Source, &src); err != nil {
+		return lock.LockDoc{}, err
+	}
+	return lock.LockDoc{Owner: src.Owner, Acquired: src.Acquired, Expires: src.Expires}, nil
+}
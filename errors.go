@@ -0,0 +1,14 @@
+package lock
+
+import "errors"
+
+var (
+	// ErrLockHeld is returned by Acquire when a valid, non-expired lock
+	// already exists, regardless of who owns it.
+	ErrLockHeld = errors.New("lock held by other client")
+
+	// ErrLockNotHeld is returned by ExtendLock when no lock document owned
+	// by this owner exists, either because it was never acquired, was
+	// released, or was taken over by another client in the meantime.
+	ErrLockNotHeld = errors.New("lock not held by this client")
+)
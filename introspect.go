@@ -0,0 +1,93 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/olivere/elastic"
+)
+
+// defaultIndexName and defaultTypeName are the ES index/type used by
+// RWLock, ListLocks and PurgeStale, which (unlike Lock) aren't yet decoupled
+// from Elasticsearch behind the Backend interface.
+const (
+	defaultIndexName = "distributed-locks"
+	defaultTypeName  = "lock"
+)
+
+// ListOptions controls the behavior of ListLocks.
+type ListOptions struct {
+	// StaleOnly restricts the results to locks that have expired but were
+	// never cleaned up, e.g. because the owning process crashed before it
+	// could release them.
+	StaleOnly bool
+}
+
+// LockInfo describes a single lock document, for introspection purposes.
+type LockInfo struct {
+	ID       string
+	Owner    string
+	Acquired time.Time
+	Expires  time.Time
+	// Stale is true when Expires is in the past, i.e. the lock document is
+	// left over from a client that never released it.
+	Stale bool
+}
+
+// listLocksScrollSize is the page size used to scroll through the
+// distributed-locks index, so ListLocks isn't capped at a single page of
+// results the way a plain Search().Size() call would be.
+const listLocksScrollSize = 1000
+
+// ListLocks returns every lock document found in the distributed-locks
+// index, for diagnosing stuck locks without hand-crafting ES queries. It
+// scrolls through the whole index, so it returns a complete result even
+// when there are more documents than fit in a single page.
+func ListLocks(ctx context.Context, client *elastic.Client, opts ListOptions) ([]LockInfo, error) {
+	now := time.Now()
+	var locks []LockInfo
+	scroll := client.Scroll(defaultIndexName).Type(defaultTypeName).Query(elastic.NewMatchAllQuery()).Size(listLocksScrollSize)
+	for {
+		result, err := scroll.Do(ctx)
+		if err == io.EOF {
+			return locks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, hit := range result.Hits.Hits {
+			var doc struct {
+				Owner    string    `json:"owner"`
+				Acquired time.Time `json:"acquired"`
+				Expires  time.Time `json:"expires"`
+			}
+			if err := json.Unmarshal(*hit.Source, &doc); err != nil {
+				return nil, err
+			}
+			stale := doc.Expires.Before(now)
+			if opts.StaleOnly && !stale {
+				continue
+			}
+			locks = append(locks, LockInfo{
+				ID:       hit.Id,
+				Owner:    doc.Owner,
+				Acquired: doc.Acquired,
+				Expires:  doc.Expires,
+				Stale:    stale,
+			})
+		}
+	}
+}
+
+// PurgeStale deletes every lock document that has expired, and returns how
+// many were deleted.
+func PurgeStale(ctx context.Context, client *elastic.Client) (int64, error) {
+	query := elastic.NewRangeQuery("expires").Lt(time.Now())
+	resp, err := client.DeleteByQuery().Index(defaultIndexName).Query(query).Refresh("true").Conflicts("proceed").Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return resp.Deleted, nil
+}
@@ -0,0 +1,68 @@
+package lock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	distlock "github.com/graup/es-distributed-lock"
+)
+
+func TestListLocksAndPurgeStale(t *testing.T) {
+	client, err := NewElasticClient("localhost:9200")
+	if err != nil {
+		t.Errorf("Failed to create elastic client: %q", err)
+	}
+	ctx := context.Background()
+	backend, err := newTestBackend("localhost:9200")
+	if err != nil {
+		t.Errorf("Failed to create backend: %q", err)
+	}
+
+	fresh := distlock.NewLock(backend, "introspect-fresh").WithOwner("client0")
+	if err := fresh.Acquire(ctx, 1*time.Minute); err != nil {
+		t.Errorf("Acquire() failed: %v", err)
+	}
+	defer fresh.Release()
+
+	stale := distlock.NewLock(backend, "introspect-stale").WithOwner("client1")
+	if err := stale.Acquire(ctx, 1*time.Millisecond); err != nil {
+		t.Errorf("Acquire() failed: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	locks, err := distlock.ListLocks(ctx, client, distlock.ListOptions{})
+	if err != nil {
+		t.Errorf("distlock.ListLocks() failed: %v", err)
+	}
+	var sawFresh, sawStale bool
+	for _, l := range locks {
+		if l.ID == "introspect-fresh" && !l.Stale {
+			sawFresh = true
+		}
+		if l.ID == "introspect-stale" && l.Stale {
+			sawStale = true
+		}
+	}
+	if !sawFresh || !sawStale {
+		t.Errorf("distlock.ListLocks() = %+v; missing expected entries", locks)
+	}
+
+	staleOnly, err := distlock.ListLocks(ctx, client, distlock.ListOptions{StaleOnly: true})
+	if err != nil {
+		t.Errorf("distlock.ListLocks() failed: %v", err)
+	}
+	for _, l := range staleOnly {
+		if l.ID == "introspect-fresh" {
+			t.Errorf("distlock.ListLocks(StaleOnly) returned a non-stale lock: %+v", l)
+		}
+	}
+
+	deleted, err := distlock.PurgeStale(ctx, client)
+	if err != nil {
+		t.Errorf("distlock.PurgeStale() failed: %v", err)
+	}
+	if deleted == 0 {
+		t.Errorf("distlock.PurgeStale() deleted 0 documents, expected at least 1")
+	}
+}
@@ -3,19 +3,17 @@ package lock
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/olivere/elastic"
 )
 
-// Lock implements a distributed lock using Elasticsearch.
+// Lock implements a distributed lock on top of a pluggable Backend.
 // The use case of this lock is improving efficiency (not correctness)
 type Lock struct {
-	client          *elastic.Client
-	indexName       string
-	typeName        string
+	backend         Backend
 	lastTTL         time.Duration
 	ID              string    `json:"-"`
 	Owner           string    `json:"owner"`
@@ -24,6 +22,7 @@ type Lock struct {
 	isAcquired      bool
 	isReleased      bool
 	keepAliveActive bool
+	lostCh          chan struct{}
 	mutex           *sync.Mutex
 }
 
@@ -31,14 +30,14 @@ var (
 	clientID = uuid.New().String()
 )
 
-// NewLock create a new lock identified by a string
-func NewLock(client *elastic.Client, id string) *Lock {
+// NewLock creates a new lock identified by a string, stored through the
+// given Backend. Use elasticv6.New or elasticv7.New to back it with
+// Elasticsearch, or memlock.New for an in-memory backend in tests.
+func NewLock(backend Backend, id string) *Lock {
 	return &Lock{
-		client:          client,
+		backend:         backend,
 		ID:              id,
 		Owner:           clientID,
-		indexName:       "distributed-locks",
-		typeName:        "lock",
 		isAcquired:      false,
 		isReleased:      false,
 		keepAliveActive: false,
@@ -53,63 +52,135 @@ func (lock *Lock) WithOwner(owner string) *Lock {
 	return lock
 }
 
-// Acquire tries to acquire a lock with a TTL.
-// Returns nil when succesful or error otherwise.
+// Acquire tries to create the lock with a TTL. It only succeeds if no valid
+// (non-expired) lock document already exists, even one owned by this same
+// client — use ExtendLock to renew a lock you already hold.
+// Returns nil when succesful, ErrLockHeld if a valid lock already exists, or
+// another error otherwise.
 func (lock *Lock) Acquire(ctx context.Context, ttl time.Duration) error {
 	lock.mutex.Lock()
 	defer lock.mutex.Unlock()
 	lock.lastTTL = ttl
 	lock.Acquired = time.Now()
 	lock.Expires = lock.Acquired.Add(ttl)
-	// This script ensures that the owner is the same so that a single process can renew a named lock over again.
-	// In case the lock is expired, another process can take over.
-	script := elastic.NewScript(`
-	if (ctx._source.owner != params.owner && ZonedDateTime.parse(ctx._source.expires).isAfter(ZonedDateTime.parse(params.now))) {
-		ctx.op = "none";
-	} else {
-		ctx._source.expires = params.expires;
-		if (ctx._source.owner != params.owner) {
-			ctx._source.owner = params.owner;
-			ctx._source.acquired = params.acquired;
-		}
+	result, err := lock.backend.AcquireDoc(ctx, lock.ID, lock.Owner, lock.Expires)
+	if err != nil {
+		return err
 	}
-	`)
-	script.Params(map[string]interface{}{
-		"now":      time.Now(),
-		"owner":    lock.Owner,
-		"expires":  lock.Expires,
-		"acquired": lock.Acquired,
-	})
-	resp, err := lock.client.Update().Index(lock.indexName).Type(lock.typeName).Id(lock.ID).Script(script).Upsert(lock).Refresh("true").ScriptedUpsert(true).Do(ctx)
-	if elastic.IsConflict(err) || err == nil && resp.Result == "noop" {
-		return fmt.Errorf("lock held by other client")
+	if !result.Acquired {
+		return ErrLockHeld
 	}
-	if err != nil {
+	lock.isAcquired = true
+	lock.isReleased = false
+	return nil
+}
+
+// ExtendLock renews the lock's TTL, but only if it is still held by this
+// client's owner. Returns ErrLockNotHeld if no lock document owned by this
+// client exists, i.e. it was never acquired, was released, or was taken over
+// by another owner in the meantime. A lock that has expired but was not taken
+// over is still extended.
+func (lock *Lock) ExtendLock(ctx context.Context, ttl time.Duration) error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+	expires := time.Now().Add(ttl)
+	if err := lock.backend.ExtendDoc(ctx, lock.ID, lock.Owner, expires); err != nil {
 		return err
 	}
+	lock.lastTTL = ttl
+	lock.Expires = expires
 	lock.isAcquired = true
 	lock.isReleased = false
 	return nil
 }
 
+// TryLock attempts to acquire the lock once and reports whether it succeeded,
+// rather than returning ErrLockHeld as Acquire does. Any other error (e.g. a
+// connection failure) is still returned as-is.
+func (lock *Lock) TryLock(ctx context.Context, ttl time.Duration) (bool, error) {
+	err := lock.Acquire(ctx, ttl)
+	if err == ErrLockHeld {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Lock blocks until the lock can be acquired or ctx is cancelled. It polls
+// the existing lock document on conflict and sleeps until just after its
+// expiry (plus jitter, to avoid a thundering herd of waiters all retrying at
+// once) instead of using a fixed backoff.
+func (lock *Lock) Lock(ctx context.Context, ttl time.Duration) error {
+	for {
+		ok, err := lock.TryLock(ctx, ttl)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		wait, err := lock.timeUntilFree(ctx)
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// timeUntilFree returns how long to wait before the current lock holder's
+// TTL expires, plus a small jitter. If the document no longer exists (e.g. it
+// was deleted in the meantime), it returns a short wait so the caller retries
+// right away; any other error from the backend is returned.
+func (lock *Lock) timeUntilFree(ctx context.Context) (time.Duration, error) {
+	jitter := time.Duration(rand.Int63n(int64(50 * time.Millisecond)))
+	doc, err := lock.backend.Get(ctx, lock.ID)
+	if err == ErrLockNotFound {
+		return jitter, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	wait := time.Until(doc.Expires)
+	if wait < 0 {
+		wait = 0
+	}
+	return wait + jitter, nil
+}
+
 // KeepAlive causes the lock to automatically extend its TTL to avoid expiration.
-// This keep going until the context is cancelled, Release() is called, or the process dies.
-// This calls Acquire again {beforeExpiry} before expirt.
-// Don't use KeepAlive with very short TTLs, rather call Acquire yourself when you need to.
-func (lock *Lock) KeepAlive(ctx context.Context, beforeExpiry time.Duration) error {
+// This keeps going until the context is cancelled, Release() is called, or the process dies.
+// This calls ExtendLock again {beforeExpiry} before expiry.
+// Don't use KeepAlive with very short TTLs, rather call ExtendLock yourself when you need to.
+//
+// It returns a channel that is closed when the lock is lost, i.e. a renewal
+// failed, either because another owner took it over (for example, after ES
+// was unreachable for longer than the TTL) or because the backend returned
+// any other error. Callers using this
+// lock to gate a critical section, such as leader election, should select on
+// this channel and abort promptly rather than assuming they still hold it.
+func (lock *Lock) KeepAlive(ctx context.Context, beforeExpiry time.Duration) (<-chan struct{}, error) {
 	lock.mutex.Lock()
 	defer lock.mutex.Unlock()
 	if !lock.isAcquired {
-		return fmt.Errorf("acquire lock before keep alive")
+		return nil, fmt.Errorf("acquire lock before keep alive")
 	}
 	if lock.keepAliveActive {
-		return nil
+		return lock.lostCh, nil
 	}
 	if beforeExpiry >= lock.lastTTL {
-		return fmt.Errorf("KeepAlive's beforeExpire (%v) should be smaller than lock's TTL (%v)", beforeExpiry, lock.lastTTL)
+		return nil, fmt.Errorf("KeepAlive's beforeExpire (%v) should be smaller than lock's TTL (%v)", beforeExpiry, lock.lastTTL)
+	}
+	if lock.lostCh == nil {
+		lock.lostCh = make(chan struct{})
 	}
 
-	// Call Acquire {beforeExpiry} before lock expires
+	// Call ExtendLock {beforeExpiry} before lock expires
 	timeLeft := lock.Expires.Add(-beforeExpiry).Sub(time.Now())
 	if timeLeft <= 0 {
 		timeLeft = 1 * time.Millisecond
@@ -119,13 +190,22 @@ func (lock *Lock) KeepAlive(ctx context.Context, beforeExpiry time.Duration) err
 		lock.mutex.Lock()
 		lock.keepAliveActive = false
 		isReleased := lock.isReleased
+		lostCh := lock.lostCh
 		lock.mutex.Unlock()
-		if !isReleased {
-			lock.Acquire(ctx, lock.lastTTL)
-			lock.KeepAlive(ctx, beforeExpiry)
+		if isReleased {
+			return
 		}
+		if err := lock.ExtendLock(ctx, lock.lastTTL); err != nil {
+			lock.mutex.Lock()
+			lock.isAcquired = false
+			lock.lostCh = nil
+			lock.mutex.Unlock()
+			close(lostCh)
+			return
+		}
+		lock.KeepAlive(ctx, beforeExpiry)
 	})
-	return nil
+	return lock.lostCh, nil
 }
 
 func (lock *Lock) release(errorIfNoop bool) error {
@@ -137,26 +217,21 @@ func (lock *Lock) release(errorIfNoop bool) error {
 		}
 		return nil
 	}
-	ctx := context.Background()
-	// Query checking that lock is still held by this client
-	query := elastic.NewBoolQuery().Must(
-		elastic.NewTermQuery("_id", lock.ID),
-		elastic.NewTermQuery("owner.keyword", lock.Owner), // Without .keyword, this fails at matching analyzed strings (e.g. containing hyphens or spaces)
-	)
-	resp, err := lock.client.DeleteByQuery().Index(lock.indexName).Query(query).Refresh("true").Conflicts("proceed").Do(ctx)
+	deleted, err := lock.backend.DeleteIfOwner(context.Background(), lock.ID, lock.Owner)
 	if err != nil {
 		return err
 	}
 	lock.isReleased = true
 	lock.isAcquired = false
-	if errorIfNoop && resp.Deleted == 0 {
+	lock.lostCh = nil
+	if errorIfNoop && deleted == 0 {
 		return fmt.Errorf("release had no effect (lock: %v, client: %v)", lock.ID, lock.Owner)
 	}
 	return nil
 }
 
 // Release removes the lock (if it is still held).
-// The only case this errors is if there's a connection error with ES.
+// The only case this errors is if there's a connection error with the backend.
 func (lock *Lock) Release() error {
 	return lock.release(false)
 }
@@ -1,4 +1,4 @@
-package lock
+package lock_test
 
 import (
 	"context"
@@ -9,6 +9,8 @@ import (
 	"testing"
 	"time"
 
+	distlock "github.com/graup/es-distributed-lock"
+	"github.com/graup/es-distributed-lock/elasticv6"
 	"github.com/olivere/elastic"
 )
 
@@ -33,12 +35,20 @@ func NewElasticClient(esURL string) (*elastic.Client, error) {
 	return client, nil
 }
 
+func newTestBackend(esURL string) (distlock.Backend, error) {
+	client, err := NewElasticClient(esURL)
+	if err != nil {
+		return nil, err
+	}
+	return elasticv6.New(client, "distributed-locks", "lock"), nil
+}
+
 func TestLock(t *testing.T) {
-	client, err := NewElasticClient("localhost:9200")
+	backend, err := newTestBackend("localhost:9200")
 	if err != nil {
-		t.Errorf("Failed to create elastic client: %q", err)
+		t.Errorf("Failed to create backend: %q", err)
 	}
-	lock := NewLock(client, "indexing-simple")
+	lock := distlock.NewLock(backend, "indexing-simple")
 	ctx := context.Background()
 	if err := lock.Acquire(ctx, 1*time.Second); err != nil {
 		t.Errorf("Acquire() failed: %v", err)
@@ -49,20 +59,20 @@ func TestLock(t *testing.T) {
 }
 
 func TestExclusiveLock(t *testing.T) {
-	client, err := NewElasticClient("localhost:9200")
+	backend, err := newTestBackend("localhost:9200")
 	if err != nil {
-		t.Errorf("Failed to create elastic client: %q", err)
+		t.Errorf("Failed to create backend: %q", err)
 	}
 	ctx := context.Background()
-	lock := NewLock(client, "indexing-keepalive").WithOwner("client0")
+	lock := distlock.NewLock(backend, "indexing-keepalive").WithOwner("client0")
 	if err := lock.Acquire(ctx, 500*time.Millisecond); err != nil {
 		t.Errorf("Acquire() failed: %v", err)
 	}
 	defer lock.Release()
 
-	lock2 := NewLock(client, "indexing-keepalive").WithOwner("client1")
-	if err := lock2.Acquire(ctx, 500*time.Millisecond); err == nil || err.Error() != "lock held by other client" {
-		t.Errorf("expected error: lock should be held by other client")
+	lock2 := distlock.NewLock(backend, "indexing-keepalive").WithOwner("client1")
+	if err := lock2.Acquire(ctx, 500*time.Millisecond); err != distlock.ErrLockHeld {
+		t.Errorf("expected distlock.ErrLockHeld, got: %v", err)
 	}
 
 	// Wait for lock1 to expire and then retry lock2
@@ -80,19 +90,19 @@ func TestExclusiveLock(t *testing.T) {
 
 func TestExclusiveLock2(t *testing.T) {
 	// Don't delete other client's lock
-	client, err := NewElasticClient("localhost:9200")
+	backend, err := newTestBackend("localhost:9200")
 	if err != nil {
-		t.Errorf("Failed to create elastic client: %q", err)
+		t.Errorf("Failed to create backend: %q", err)
 	}
 	ctx := context.Background()
-	lock := NewLock(client, "indexing-keepalive").WithOwner("client0")
+	lock := distlock.NewLock(backend, "indexing-keepalive").WithOwner("client0")
 	if err := lock.Acquire(ctx, 500*time.Millisecond); err != nil {
 		t.Errorf("Acquire() failed: %v", err)
 	}
 
 	// Wait for lock1 to expire and then get lock2
 	time.Sleep(500 * time.Millisecond)
-	lock2 := NewLock(client, "indexing-keepalive").WithOwner("client1")
+	lock2 := distlock.NewLock(backend, "indexing-keepalive").WithOwner("client1")
 	if err := lock2.Acquire(ctx, 500*time.Millisecond); err != nil {
 		t.Errorf("Acquire() failed: %v", err)
 	}
@@ -105,17 +115,19 @@ func TestExclusiveLock2(t *testing.T) {
 }
 
 func TestKeepAlive(t *testing.T) {
-	client, err := NewElasticClient("localhost:9200")
+	backend, err := newTestBackend("localhost:9200")
 	if err != nil {
-		t.Errorf("Failed to create elastic client: %q", err)
+		t.Errorf("Failed to create backend: %q", err)
 	}
-	lock := NewLock(client, "indexing-keepalive").WithOwner("client0")
+	lock := distlock.NewLock(backend, "indexing-keepalive").WithOwner("client0")
 	defer lock.Release()
 	ctx := context.Background()
 	if err := lock.Acquire(ctx, 1000*time.Millisecond); err != nil {
 		t.Errorf("Acquire() failed: %v", err)
 	}
-	lock.KeepAlive(ctx, 250*time.Millisecond)
+	if _, err := lock.KeepAlive(ctx, 250*time.Millisecond); err != nil {
+		t.Errorf("KeepAlive() failed: %v", err)
+	}
 	time.Sleep(1100 * time.Millisecond)
 	if lock.IsAcquired() == false {
 		t.Errorf("IsAcquired() returned false")
@@ -135,18 +147,18 @@ func TestKeepAlive(t *testing.T) {
 }
 
 func TestKeepAliveLater(t *testing.T) {
-	client, err := NewElasticClient("localhost:9200")
+	backend, err := newTestBackend("localhost:9200")
 	if err != nil {
-		t.Errorf("Failed to create elastic client: %q", err)
+		t.Errorf("Failed to create backend: %q", err)
 	}
-	lock := NewLock(client, "indexing-keepalive2").WithOwner("client0")
+	lock := distlock.NewLock(backend, "indexing-keepalive2").WithOwner("client0")
 	defer lock.Release()
 	ctx := context.Background()
 	if err := lock.Acquire(ctx, 700*time.Millisecond); err != nil {
 		t.Errorf("Acquire() failed: %v", err)
 	}
 	time.Sleep(800 * time.Millisecond)
-	if err := lock.KeepAlive(ctx, 500*time.Millisecond); err != nil {
+	if _, err := lock.KeepAlive(ctx, 500*time.Millisecond); err != nil {
 		t.Errorf("KeepAlive() failed: %v", err)
 	}
 	time.Sleep(300 * time.Millisecond)
@@ -156,50 +168,172 @@ func TestKeepAliveLater(t *testing.T) {
 }
 
 func TestKeepAliveTooQuick(t *testing.T) {
-	client, err := NewElasticClient("localhost:9200")
+	backend, err := newTestBackend("localhost:9200")
 	if err != nil {
-		t.Errorf("Failed to create elastic client: %q", err)
+		t.Errorf("Failed to create backend: %q", err)
 	}
-	lock := NewLock(client, "indexing-keepalive2").WithOwner("client0")
+	lock := distlock.NewLock(backend, "indexing-keepalive2").WithOwner("client0")
 	defer lock.Release()
 	ctx := context.Background()
 	if err := lock.Acquire(ctx, 1*time.Second); err != nil {
 		t.Errorf("Acquire() failed: %v", err)
 	}
-	if err := lock.KeepAlive(ctx, 1*time.Second); err == nil {
+	if _, err := lock.KeepAlive(ctx, 1*time.Second); err == nil {
 		t.Errorf("KeepAlive() should return error (too short beforeExpiry)")
 	}
 }
 
 func TestKeepAliveBeforeAcquire(t *testing.T) {
-	client, err := NewElasticClient("localhost:9200")
+	backend, err := newTestBackend("localhost:9200")
 	if err != nil {
-		t.Errorf("Failed to create elastic client: %q", err)
+		t.Errorf("Failed to create backend: %q", err)
 	}
-	lock := NewLock(client, "indexing-keepalive2").WithOwner("client0")
+	lock := distlock.NewLock(backend, "indexing-keepalive2").WithOwner("client0")
 	defer lock.Release()
 	ctx := context.Background()
-	if err := lock.KeepAlive(ctx, 1*time.Second); err == nil {
+	if _, err := lock.KeepAlive(ctx, 1*time.Second); err == nil {
 		t.Errorf("KeepAlive() should return error (need to acquire first)")
 	}
 }
 
 func TestKeepAliveMultiple(t *testing.T) {
-	client, err := NewElasticClient("localhost:9200")
+	backend, err := newTestBackend("localhost:9200")
 	if err != nil {
-		t.Errorf("Failed to create elastic client: %q", err)
+		t.Errorf("Failed to create backend: %q", err)
 	}
-	lock := NewLock(client, "indexing-keepalive2").WithOwner("client0")
+	lock := distlock.NewLock(backend, "indexing-keepalive2").WithOwner("client0")
 	defer lock.Release()
 	ctx := context.Background()
 	if err := lock.Acquire(ctx, 1*time.Second); err != nil {
 		t.Errorf("Acquire() failed: %v", err)
 	}
 	// calling KeepAlive multiple times is fine
-	if err := lock.KeepAlive(ctx, 500*time.Millisecond); err != nil {
+	if _, err := lock.KeepAlive(ctx, 500*time.Millisecond); err != nil {
 		t.Errorf("KeepAlive() returned error: %v", err)
 	}
-	if err := lock.KeepAlive(ctx, 500*time.Millisecond); err != nil {
+	if _, err := lock.KeepAlive(ctx, 500*time.Millisecond); err != nil {
 		t.Errorf("KeepAlive() returned error: %v", err)
 	}
 }
+
+func TestExtendLock(t *testing.T) {
+	backend, err := newTestBackend("localhost:9200")
+	if err != nil {
+		t.Errorf("Failed to create backend: %q", err)
+	}
+	ctx := context.Background()
+	lock := distlock.NewLock(backend, "indexing-extend").WithOwner("client0")
+	if err := lock.Acquire(ctx, 500*time.Millisecond); err != nil {
+		t.Errorf("Acquire() failed: %v", err)
+	}
+	defer lock.Release()
+
+	if err := lock.ExtendLock(ctx, 500*time.Millisecond); err != nil {
+		t.Errorf("ExtendLock() failed: %v", err)
+	}
+
+	// A different owner can't extend a lock it doesn't hold
+	lock2 := distlock.NewLock(backend, "indexing-extend").WithOwner("client1")
+	if err := lock2.ExtendLock(ctx, 500*time.Millisecond); err != distlock.ErrLockNotHeld {
+		t.Errorf("expected distlock.ErrLockNotHeld, got: %v", err)
+	}
+}
+
+func TestKeepAliveLostChannel(t *testing.T) {
+	backend, err := newTestBackend("localhost:9200")
+	if err != nil {
+		t.Errorf("Failed to create backend: %q", err)
+	}
+	ctx := context.Background()
+	lock := distlock.NewLock(backend, "indexing-leader").WithOwner("client0")
+	if err := lock.Acquire(ctx, 300*time.Millisecond); err != nil {
+		t.Errorf("Acquire() failed: %v", err)
+	}
+	defer lock.Release()
+	lost, err := lock.KeepAlive(ctx, 200*time.Millisecond)
+	if err != nil {
+		t.Errorf("KeepAlive() failed: %v", err)
+	}
+
+	// KeepAlive keeps renewing lock0, so its lease never expires on its own.
+	// Simulate losing it by deleting lock0's document; another client then
+	// takes over, which must make the next renewal fail and close the lost
+	// channel.
+	time.Sleep(150 * time.Millisecond)
+	if _, err := backend.DeleteIfOwner(ctx, "indexing-leader", "client0"); err != nil {
+		t.Errorf("DeleteIfOwner() failed: %v", err)
+	}
+	other := distlock.NewLock(backend, "indexing-leader").WithOwner("client1")
+	if err := other.Acquire(ctx, 1*time.Second); err != nil {
+		t.Errorf("Acquire() failed: %v", err)
+	}
+	defer other.Release()
+
+	select {
+	case <-lost:
+	case <-time.After(1 * time.Second):
+		t.Errorf("expected lost channel to be closed after losing the lock")
+	}
+}
+
+func TestTryLock(t *testing.T) {
+	backend, err := newTestBackend("localhost:9200")
+	if err != nil {
+		t.Errorf("Failed to create backend: %q", err)
+	}
+	ctx := context.Background()
+	lock := distlock.NewLock(backend, "indexing-trylock").WithOwner("client0")
+	defer lock.Release()
+	ok, err := lock.TryLock(ctx, 500*time.Millisecond)
+	if err != nil || !ok {
+		t.Errorf("TryLock() = %v, %v; want true, nil", ok, err)
+	}
+
+	lock2 := distlock.NewLock(backend, "indexing-trylock").WithOwner("client1")
+	ok, err = lock2.TryLock(ctx, 500*time.Millisecond)
+	if err != nil || ok {
+		t.Errorf("TryLock() = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestLockBlocksUntilAvailable(t *testing.T) {
+	backend, err := newTestBackend("localhost:9200")
+	if err != nil {
+		t.Errorf("Failed to create backend: %q", err)
+	}
+	ctx := context.Background()
+	lock := distlock.NewLock(backend, "indexing-lock-blocking").WithOwner("client0")
+	if err := lock.Acquire(ctx, 300*time.Millisecond); err != nil {
+		t.Errorf("Acquire() failed: %v", err)
+	}
+
+	lock2 := distlock.NewLock(backend, "indexing-lock-blocking").WithOwner("client1")
+	start := time.Now()
+	if err := lock2.Lock(ctx, 500*time.Millisecond); err != nil {
+		t.Errorf("Lock() failed: %v", err)
+	}
+	defer lock2.Release()
+	if time.Since(start) < 300*time.Millisecond {
+		t.Errorf("Lock() returned before the first lock expired")
+	}
+}
+
+func TestLockRespectsCancellation(t *testing.T) {
+	backend, err := newTestBackend("localhost:9200")
+	if err != nil {
+		t.Errorf("Failed to create backend: %q", err)
+	}
+	ctx := context.Background()
+	lock := distlock.NewLock(backend, "indexing-lock-cancel").WithOwner("client0")
+	if err := lock.Acquire(ctx, 10*time.Second); err != nil {
+		t.Errorf("Acquire() failed: %v", err)
+	}
+	defer lock.Release()
+
+	cancelCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	lock2 := distlock.NewLock(backend, "indexing-lock-cancel").WithOwner("client1")
+	if err := lock2.Lock(cancelCtx, 10*time.Second); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got: %v", err)
+	}
+}
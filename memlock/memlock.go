@@ -0,0 +1,70 @@
+// Package memlock provides an in-memory lock.Backend, so tests exercising
+// locking logic don't need a live Elasticsearch cluster.
+package memlock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	lock "github.com/graup/es-distributed-lock"
+)
+
+// Backend is an in-memory lock.Backend. The zero value is not usable; create
+// one with New.
+type Backend struct {
+	mutex sync.Mutex
+	docs  map[string]lock.LockDoc
+}
+
+// New creates an empty in-memory Backend.
+func New() *Backend {
+	return &Backend{docs: make(map[string]lock.LockDoc)}
+}
+
+// AcquireDoc implements lock.Backend.
+func (b *Backend) AcquireDoc(ctx context.Context, id, owner string, expires time.Time) (lock.AcquireResult, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if doc, ok := b.docs[id]; ok && doc.Expires.After(time.Now()) {
+		return lock.AcquireResult{Acquired: false}, nil
+	}
+	b.docs[id] = lock.LockDoc{Owner: owner, Acquired: time.Now(), Expires: expires}
+	return lock.AcquireResult{Acquired: true}, nil
+}
+
+// ExtendDoc implements lock.Backend.
+func (b *Backend) ExtendDoc(ctx context.Context, id, owner string, expires time.Time) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	doc, ok := b.docs[id]
+	if !ok || doc.Owner != owner {
+		return lock.ErrLockNotHeld
+	}
+	doc.Expires = expires
+	b.docs[id] = doc
+	return nil
+}
+
+// DeleteIfOwner implements lock.Backend.
+func (b *Backend) DeleteIfOwner(ctx context.Context, id, owner string) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	doc, ok := b.docs[id]
+	if !ok || doc.Owner != owner {
+		return 0, nil
+	}
+	delete(b.docs, id)
+	return 1, nil
+}
+
+// Get implements lock.Backend.
+func (b *Backend) Get(ctx context.Context, id string) (lock.LockDoc, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	doc, ok := b.docs[id]
+	if !ok {
+		return lock.LockDoc{}, lock.ErrLockNotFound
+	}
+	return doc, nil
+}
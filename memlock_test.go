@@ -0,0 +1,41 @@
+package lock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	distlock "github.com/graup/es-distributed-lock"
+	"github.com/graup/es-distributed-lock/memlock"
+)
+
+// These tests exercise the locking logic against memlock's in-memory Backend,
+// so they run without a live Elasticsearch cluster.
+
+func TestLockWithMemoryBackend(t *testing.T) {
+	backend := memlock.New()
+	ctx := context.Background()
+	lock := distlock.NewLock(backend, "mem-simple").WithOwner("client0")
+	if err := lock.Acquire(ctx, 1*time.Second); err != nil {
+		t.Errorf("Acquire() failed: %v", err)
+	}
+
+	lock2 := distlock.NewLock(backend, "mem-simple").WithOwner("client1")
+	if err := lock2.Acquire(ctx, 1*time.Second); err != distlock.ErrLockHeld {
+		t.Errorf("expected distlock.ErrLockHeld, got: %v", err)
+	}
+
+	if err := lock.ExtendLock(ctx, 1*time.Second); err != nil {
+		t.Errorf("ExtendLock() failed: %v", err)
+	}
+	if err := lock2.ExtendLock(ctx, 1*time.Second); err != distlock.ErrLockNotHeld {
+		t.Errorf("expected distlock.ErrLockNotHeld, got: %v", err)
+	}
+
+	if err := lock.MustRelease(); err != nil {
+		t.Errorf("MustRelease() failed: %v", err)
+	}
+	if err := lock2.Acquire(ctx, 1*time.Second); err != nil {
+		t.Errorf("expected lock to be free after release, Acquire() failed: %v", err)
+	}
+}
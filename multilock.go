@@ -0,0 +1,87 @@
+package lock
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// MultiLock acquires a set of named locks as a single atomic unit: either all
+// of them are acquired, or none are. The given IDs are sorted before
+// acquisition, so two callers locking overlapping sets (e.g. {"a","b","c"}
+// and {"c","b","a"}) always attempt them in the same order and can't
+// deadlock against each other.
+type MultiLock struct {
+	backend Backend
+	owner   string
+	keys    []string
+	locks   []*Lock
+}
+
+// NewMultiLock creates a new MultiLock for the given set of lock IDs.
+func NewMultiLock(backend Backend, ids []string) *MultiLock {
+	keys := make([]string, len(ids))
+	copy(keys, ids)
+	sort.Strings(keys)
+	return &MultiLock{
+		backend: backend,
+		owner:   clientID,
+		keys:    keys,
+	}
+}
+
+// WithOwner is a shortcut method to set the owner manually for every lock in
+// the set. If you don't specify an owner, a random UUID is used automatically.
+func (m *MultiLock) WithOwner(owner string) *MultiLock {
+	m.owner = owner
+	return m
+}
+
+// AcquireAll acquires every lock in the set, in sorted order. If any single
+// acquisition fails, the locks already taken are released and the error is
+// returned; no partial set is ever left held.
+func (m *MultiLock) AcquireAll(ctx context.Context, ttl time.Duration) error {
+	locks := make([]*Lock, 0, len(m.keys))
+	for _, key := range m.keys {
+		l := NewLock(m.backend, key).WithOwner(m.owner)
+		if err := l.Acquire(ctx, ttl); err != nil {
+			for _, acquired := range locks {
+				acquired.Release()
+			}
+			return err
+		}
+		locks = append(locks, l)
+	}
+	m.locks = locks
+	return nil
+}
+
+// ReleaseAll releases every lock in the set that is still held. It keeps
+// going on error so a single stuck lock doesn't prevent releasing the rest,
+// and returns the first error encountered, if any.
+func (m *MultiLock) ReleaseAll() error {
+	var firstErr error
+	for _, l := range m.locks {
+		if err := l.Release(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// KeepAliveAll calls KeepAlive with the same beforeExpiry on every lock in
+// the set, so the whole set is renewed together. It returns one lost channel
+// per lock, in the same order as the IDs passed to NewMultiLock (after
+// sorting); losing any single lock in the set means the set as a whole is no
+// longer held atomically.
+func (m *MultiLock) KeepAliveAll(ctx context.Context, beforeExpiry time.Duration) ([]<-chan struct{}, error) {
+	lostChs := make([]<-chan struct{}, 0, len(m.locks))
+	for _, l := range m.locks {
+		lostCh, err := l.KeepAlive(ctx, beforeExpiry)
+		if err != nil {
+			return nil, err
+		}
+		lostChs = append(lostChs, lostCh)
+	}
+	return lostChs, nil
+}
@@ -0,0 +1,47 @@
+package lock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	distlock "github.com/graup/es-distributed-lock"
+	"github.com/graup/es-distributed-lock/memlock"
+)
+
+func TestMultiLockAcquireAndRelease(t *testing.T) {
+	backend := memlock.New()
+	ctx := context.Background()
+	ml := distlock.NewMultiLock(backend, []string{"multi-c", "multi-a", "multi-b"}).WithOwner("client0")
+	if err := ml.AcquireAll(ctx, 1*time.Second); err != nil {
+		t.Errorf("AcquireAll() failed: %v", err)
+	}
+	if err := ml.ReleaseAll(); err != nil {
+		t.Errorf("ReleaseAll() failed: %v", err)
+	}
+}
+
+func TestMultiLockPartialFailureReleasesAll(t *testing.T) {
+	backend := memlock.New()
+	ctx := context.Background()
+
+	// client0 takes "multi-b" ahead of time, so client1's overlapping set fails halfway.
+	held := distlock.NewLock(backend, "multi-b").WithOwner("client0")
+	if err := held.Acquire(ctx, 1*time.Second); err != nil {
+		t.Errorf("Acquire() failed: %v", err)
+	}
+	defer held.Release()
+
+	ml := distlock.NewMultiLock(backend, []string{"multi-a", "multi-b", "multi-c"}).WithOwner("client1")
+	if err := ml.AcquireAll(ctx, 1*time.Second); err != distlock.ErrLockHeld {
+		t.Errorf("expected distlock.ErrLockHeld, got: %v", err)
+	}
+
+	// "multi-a" was acquired before the failure on "multi-b"; it must have
+	// been released again so it's free for another caller.
+	other := distlock.NewLock(backend, "multi-a").WithOwner("client2")
+	if err := other.Acquire(ctx, 1*time.Second); err != nil {
+		t.Errorf("expected multi-a to be free again, Acquire() failed: %v", err)
+	}
+	defer other.Release()
+}
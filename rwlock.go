@@ -0,0 +1,168 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic"
+)
+
+// rwLockRetries is how many times an RWLock update retries on a version
+// conflict before giving up. Unlike Lock's single-owner document, an
+// RWLock's document is written by every reader and writer that touches it,
+// so concurrent callers routinely collide on its version and must retry
+// rather than be told the lock is held.
+const rwLockRetries = 5
+
+// lockHolder is a single owner/expiry pair, used both for the exclusive
+// writer and for each entry in the readers array of an RWLock document.
+type lockHolder struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// rwLockDoc is the on-disk representation of an RWLock's ES document.
+type rwLockDoc struct {
+	Writer  *lockHolder  `json:"writer"`
+	Readers []lockHolder `json:"readers"`
+}
+
+// RWLock implements a distributed reader/writer lock using Elasticsearch,
+// matching the semantics of sync.RWMutex: any number of readers may hold the
+// lock concurrently, but a writer requires exclusive access and excludes all
+// readers. This is useful for read-mostly workloads (e.g. many concurrent
+// indexers reading a shard, one exclusive re-indexer).
+//
+// Unlike Lock, RWLock isn't decoupled behind the Backend interface: its
+// document shape (one writer plus a list of readers) doesn't fit the
+// single-owner Backend methods, so it still takes a concrete *elastic.Client.
+type RWLock struct {
+	client    *elastic.Client
+	indexName string
+	typeName  string
+	ID        string
+	Owner     string
+	mutex     *sync.Mutex
+}
+
+// NewRWLock creates a new reader/writer lock identified by a string.
+func NewRWLock(client *elastic.Client, id string) *RWLock {
+	return &RWLock{
+		client:    client,
+		ID:        id,
+		Owner:     clientID,
+		indexName: defaultIndexName,
+		typeName:  defaultTypeName,
+		mutex:     &sync.Mutex{},
+	}
+}
+
+// WithOwner is a shortcut method to set the owner manually.
+// If you don't specify an owner, a random UUID is used automatically.
+func (rw *RWLock) WithOwner(owner string) *RWLock {
+	rw.Owner = owner
+	return rw
+}
+
+// RLock acquires a shared (read) lock with a TTL. It succeeds as long as no
+// writer currently holds the lock.
+func (rw *RWLock) RLock(ctx context.Context, ttl time.Duration) error {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	now := time.Now()
+	holder := lockHolder{Owner: rw.Owner, Expires: now.Add(ttl)}
+	script := elastic.NewScript(`
+	def now = ZonedDateTime.parse(params.now);
+	if (ctx._source.writer != null && ZonedDateTime.parse(ctx._source.writer.expires).isAfter(now)) {
+		ctx.op = "none";
+	} else {
+		ctx._source.writer = null;
+		if (ctx._source.readers == null) { ctx._source.readers = []; }
+		ctx._source.readers.removeIf(r -> ZonedDateTime.parse(r.expires).isBefore(now) || r.owner == params.holder.owner);
+		ctx._source.readers.add(params.holder);
+	}
+	`)
+	script.Params(map[string]interface{}{
+		"now":    now,
+		"holder": holder,
+	})
+	upsert := rwLockDoc{Readers: []lockHolder{holder}}
+	resp, err := rw.client.Update().Index(rw.indexName).Type(rw.typeName).Id(rw.ID).Script(script).Upsert(upsert).Refresh("true").ScriptedUpsert(true).RetryOnConflict(rwLockRetries).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if resp.Result == "noop" {
+		return ErrLockHeld
+	}
+	return nil
+}
+
+// Lock acquires an exclusive (write) lock with a TTL. It succeeds only when
+// there is no active writer and no active readers.
+func (rw *RWLock) Lock(ctx context.Context, ttl time.Duration) error {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	now := time.Now()
+	holder := lockHolder{Owner: rw.Owner, Expires: now.Add(ttl)}
+	script := elastic.NewScript(`
+	if (ctx.op == "create") {
+		ctx._source.writer = params.holder;
+	} else {
+		def now = ZonedDateTime.parse(params.now);
+		boolean writerFree = ctx._source.writer == null || ZonedDateTime.parse(ctx._source.writer.expires).isBefore(now);
+		if (ctx._source.readers != null) {
+			ctx._source.readers.removeIf(r -> ZonedDateTime.parse(r.expires).isBefore(now));
+		}
+		boolean readersFree = ctx._source.readers == null || ctx._source.readers.isEmpty();
+		if (!writerFree || !readersFree) {
+			ctx.op = "none";
+		} else {
+			ctx._source.writer = params.holder;
+		}
+	}
+	`)
+	script.Params(map[string]interface{}{
+		"now":    now,
+		"holder": holder,
+	})
+	upsert := rwLockDoc{Writer: &holder}
+	resp, err := rw.client.Update().Index(rw.indexName).Type(rw.typeName).Id(rw.ID).Script(script).Upsert(upsert).Refresh("true").ScriptedUpsert(true).RetryOnConflict(rwLockRetries).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if resp.Result == "noop" {
+		return ErrLockHeld
+	}
+	return nil
+}
+
+// RUnlock releases this owner's read lock, if held.
+func (rw *RWLock) RUnlock(ctx context.Context) error {
+	return rw.unlock(ctx, `
+	if (ctx._source.readers != null) {
+		ctx._source.readers.removeIf(r -> r.owner == params.owner);
+	}
+	`)
+}
+
+// Unlock releases this owner's write lock, if held.
+func (rw *RWLock) Unlock(ctx context.Context) error {
+	return rw.unlock(ctx, `
+	if (ctx._source.writer != null && ctx._source.writer.owner == params.owner) {
+		ctx._source.writer = null;
+	}
+	`)
+}
+
+func (rw *RWLock) unlock(ctx context.Context, scriptSource string) error {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	script := elastic.NewScript(scriptSource)
+	script.Params(map[string]interface{}{"owner": rw.Owner})
+	_, err := rw.client.Update().Index(rw.indexName).Type(rw.typeName).Id(rw.ID).Script(script).Refresh("true").RetryOnConflict(rwLockRetries).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package lock_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	distlock "github.com/graup/es-distributed-lock"
+)
+
+func TestRWLockMultipleReaders(t *testing.T) {
+	client, err := NewElasticClient("localhost:9200")
+	if err != nil {
+		t.Errorf("Failed to create elastic client: %q", err)
+	}
+	ctx := context.Background()
+	r1 := distlock.NewRWLock(client, "rw-readers").WithOwner("client0")
+	r2 := distlock.NewRWLock(client, "rw-readers").WithOwner("client1")
+	if err := r1.RLock(ctx, 1*time.Second); err != nil {
+		t.Errorf("RLock() failed: %v", err)
+	}
+	defer r1.RUnlock(ctx)
+	if err := r2.RLock(ctx, 1*time.Second); err != nil {
+		t.Errorf("RLock() failed: %v", err)
+	}
+	defer r2.RUnlock(ctx)
+}
+
+func TestRWLockConcurrentReaders(t *testing.T) {
+	client, err := NewElasticClient("localhost:9200")
+	if err != nil {
+		t.Errorf("Failed to create elastic client: %q", err)
+	}
+	ctx := context.Background()
+
+	// Both readers race to write the same rwLockDoc; without RetryOnConflict,
+	// one of them would lose the version race and fail with a version
+	// conflict error even though no writer ever held the lock.
+	var wg sync.WaitGroup
+	readers := make([]*distlock.RWLock, 2)
+	errs := make([]error, 2)
+	for i := 0; i < 2; i++ {
+		readers[i] = distlock.NewRWLock(client, "rw-concurrent-readers").WithOwner(fmt.Sprintf("client%d", i))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = readers[i].RLock(ctx, 1*time.Second)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("RLock() for reader %d failed: %v", i, err)
+		}
+		defer readers[i].RUnlock(ctx)
+	}
+}
+
+func TestRWLockWriterExcludesReaders(t *testing.T) {
+	client, err := NewElasticClient("localhost:9200")
+	if err != nil {
+		t.Errorf("Failed to create elastic client: %q", err)
+	}
+	ctx := context.Background()
+	w := distlock.NewRWLock(client, "rw-writer").WithOwner("client0")
+	if err := w.Lock(ctx, 1*time.Second); err != nil {
+		t.Errorf("Lock() failed: %v", err)
+	}
+	defer w.Unlock(ctx)
+
+	r := distlock.NewRWLock(client, "rw-writer").WithOwner("client1")
+	if err := r.RLock(ctx, 1*time.Second); err != distlock.ErrLockHeld {
+		t.Errorf("expected distlock.ErrLockHeld, got: %v", err)
+	}
+}
+
+func TestRWLockReaderExcludesWriter(t *testing.T) {
+	client, err := NewElasticClient("localhost:9200")
+	if err != nil {
+		t.Errorf("Failed to create elastic client: %q", err)
+	}
+	ctx := context.Background()
+	r := distlock.NewRWLock(client, "rw-reader-blocks-writer").WithOwner("client0")
+	if err := r.RLock(ctx, 1*time.Second); err != nil {
+		t.Errorf("RLock() failed: %v", err)
+	}
+	defer r.RUnlock(ctx)
+
+	w := distlock.NewRWLock(client, "rw-reader-blocks-writer").WithOwner("client1")
+	if err := w.Lock(ctx, 1*time.Second); err != distlock.ErrLockHeld {
+		t.Errorf("expected distlock.ErrLockHeld, got: %v", err)
+	}
+}